@@ -0,0 +1,109 @@
+/*
+ * Copyright 2018-2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/SQLess/SQLess/cmd/cql/internal/feeoracle"
+	"github.com/SQLess/SQLess/types"
+)
+
+var (
+	feeOracleToken      string
+	feeOracleBlocks     int
+	feeOraclePercentile int
+)
+
+// CmdFeeOracle is cql fee-oracle command entity.
+var CmdFeeOracle = &Command{
+	UsageLine: "cql fee-oracle [common params] -token token_type [-blocks count] [-percentile number]",
+	Short:     "suggest a fee for transferring a token",
+	Long: `
+FeeOracle samples the last N confirmed blocks and suggests a fee for transferring the given
+token, based on a percentile of the fees miners have recently accepted. "cql transfer"
+consults the same oracle whenever -fee is omitted.
+e.g.
+    cql fee-oracle -token Particle -blocks 20 -percentile 60
+`,
+	Flag:       flag.NewFlagSet("FeeOracle params", flag.ExitOnError),
+	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
+	DebugFlag:  flag.NewFlagSet("Debug params", flag.ExitOnError),
+}
+
+// feeOracleResult is the JSON document printed for -output=json.
+type feeOracleResult struct {
+	Token      string `json:"token"`
+	Fee        uint64 `json:"fee"`
+	Blocks     int    `json:"blocks"`
+	Percentile int    `json:"percentile"`
+}
+
+func init() {
+	CmdFeeOracle.Run = runFeeOracle
+
+	addCommonFlags(CmdFeeOracle)
+	addOutputFlag(CmdFeeOracle)
+	addConfigFlag(CmdFeeOracle)
+	CmdFeeOracle.Flag.StringVar(&feeOracleToken, "token", "", "Token type to suggest a fee for, e.g. Particle, Wave")
+	CmdFeeOracle.Flag.IntVar(&feeOracleBlocks, "blocks", feeoracle.DefaultConfig.Blocks, "Number of recent confirmed blocks to sample")
+	CmdFeeOracle.Flag.IntVar(&feeOraclePercentile, "percentile", feeoracle.DefaultConfig.Percentile, "Percentile of the sampled fees to suggest")
+}
+
+func runFeeOracle(cmd *Command, args []string) {
+	commonFlagsInit(cmd)
+
+	unit := types.FromString(feeOracleToken)
+	if !unit.Listed() {
+		reportFeeOracleError(fmt.Errorf("fee-oracle command needs a valid -token"))
+		return
+	}
+
+	configInit()
+
+	cfg := feeoracle.DefaultConfig
+	cfg.Blocks = feeOracleBlocks
+	cfg.Percentile = feeOraclePercentile
+
+	suggestion, err := feeoracle.Suggest(unit, cfg)
+	if err != nil {
+		reportFeeOracleError(err)
+		return
+	}
+
+	if jsonOutput() {
+		printResult(feeOracleResult{
+			Token:      feeOracleToken,
+			Fee:        suggestion.Fee,
+			Blocks:     suggestion.Blocks,
+			Percentile: suggestion.Percentile,
+		})
+		return
+	}
+	fmt.Printf("suggested fee for %v: %v (sampled %v blocks at %vth percentile)\n",
+		feeOracleToken, suggestion.Fee, suggestion.Blocks, suggestion.Percentile)
+}
+
+func reportFeeOracleError(err error) {
+	if jsonOutput() {
+		printResultError(err)
+	} else {
+		ConsoleLog.WithError(err).Error("fee oracle failed")
+	}
+	SetExitStatus(1)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2018-2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package feeoracle suggests a fee for a token transfer by sampling the
+// fees miners have recently accepted, the same shape as geth's gasprice
+// oracle: a sliding window of confirmed blocks, a percentile over the
+// observed fees, and a hard cap.
+package feeoracle
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/SQLess/SQLess/client"
+	"github.com/SQLess/SQLess/types"
+)
+
+// Config controls how Suggest samples the chain and derives a fee.
+type Config struct {
+	// Blocks is the size of the sliding window of confirmed blocks to sample.
+	Blocks int
+	// Percentile of the sampled, sorted fees to suggest.
+	Percentile int
+	// MaxFee caps the suggestion regardless of the sampled percentile. Zero means no cap.
+	MaxFee uint64
+}
+
+// DefaultConfig mirrors geth's DefaultFullGPOConfig{Blocks: 20, Percentile: 60}:
+// a 20-block window, 60th percentile, and a generous-but-finite cap.
+var DefaultConfig = Config{
+	Blocks:     20,
+	Percentile: 60,
+	MaxFee:     1 << 20,
+}
+
+// Suggestion is the recommended fee for a token, along with the sample it
+// was derived from.
+type Suggestion struct {
+	Token      types.CoinType
+	Fee        uint64
+	Blocks     int
+	Percentile int
+}
+
+// Suggest returns a recommended fee for transferring token, sampling the
+// last cfg.Blocks confirmed blocks.
+func Suggest(token types.CoinType, cfg Config) (Suggestion, error) {
+	if cfg.Percentile < 0 || cfg.Percentile > 100 {
+		return Suggestion{}, fmt.Errorf("percentile must be between 0 and 100, got %d", cfg.Percentile)
+	}
+
+	fees, err := client.RecentTransferFees(token, cfg.Blocks)
+	if err != nil {
+		return Suggestion{}, fmt.Errorf("sample recent fees: %w", err)
+	}
+	if len(fees) == 0 {
+		return Suggestion{}, fmt.Errorf("no confirmed blocks to sample fees from")
+	}
+
+	sort.Slice(fees, func(i, j int) bool { return fees[i] < fees[j] })
+	fee := fees[percentileIndex(len(fees), cfg.Percentile)]
+	if cfg.MaxFee > 0 && fee > cfg.MaxFee {
+		fee = cfg.MaxFee
+	}
+
+	return Suggestion{Token: token, Fee: fee, Blocks: len(fees), Percentile: cfg.Percentile}, nil
+}
+
+// percentileIndex returns the index into a sorted, n-long slice that
+// holds its percentile-th value. percentile must already be validated
+// to be within [0, 100].
+func percentileIndex(n, percentile int) int {
+	idx := n * percentile / 100
+	if idx >= n {
+		idx = n - 1
+	}
+	return idx
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2018-2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package feeoracle
+
+import "testing"
+
+func TestPercentileIndex(t *testing.T) {
+	testCases := []struct {
+		name       string
+		n          int
+		percentile int
+		want       int
+	}{
+		{"0th percentile", 20, 0, 0},
+		{"60th percentile of 20", 20, 60, 12},
+		{"100th percentile clamps to last index", 20, 100, 19},
+		{"single sample", 1, 60, 0},
+		{"percentile just under 100 rounds down", 5, 99, 4},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := percentileIndex(tc.n, tc.percentile)
+			if got != tc.want {
+				t.Fatalf("percentileIndex(%d, %d) = %d, want %d", tc.n, tc.percentile, got, tc.want)
+			}
+			if got < 0 || got >= tc.n {
+				t.Fatalf("percentileIndex(%d, %d) = %d is out of range [0, %d)", tc.n, tc.percentile, got, tc.n)
+			}
+		})
+	}
+}
@@ -58,6 +58,8 @@ Use "cql help <command>" for more information about a command.
 func init() {
 	CmdVersion.Run = runVersion
 	CmdHelp.Run = runHelp
+
+	addOutputFlag(CmdVersion)
 }
 
 // PrintVersion prints program git version.
@@ -72,7 +74,26 @@ func PrintVersion(printLog bool) string {
 	return version
 }
 
+// versionResult is the JSON document printed for "cql version -output=json".
+type versionResult struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+	Go      string `json:"go"`
+}
+
 func runVersion(cmd *Command, args []string) {
+	if jsonOutput() {
+		printResult(versionResult{
+			Name:    name,
+			Version: Version,
+			OS:      runtime.GOOS,
+			Arch:    runtime.GOARCH,
+			Go:      runtime.Version(),
+		})
+		return
+	}
 	fmt.Print(PrintVersion(false))
 }
 
@@ -17,16 +17,21 @@
 package internal
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/SQLess/SQLess/cmd/cql/internal/monotime"
 	"github.com/SQLess/SQLess/crypto/asymmetric"
 	"github.com/SQLess/SQLess/crypto/kms"
 	mine "github.com/SQLess/SQLess/pow/cpuminer"
@@ -35,13 +40,16 @@ import (
 )
 
 var (
-	difficulty int
-	loop       bool
+	difficulty         int
+	loop               bool
+	resumeLoop         bool
+	showBest           bool
+	checkpointInterval time.Duration
 )
 
 // CmdIDMiner is cql idminer command entity.
 var CmdIDMiner = &Command{
-	UsageLine: "cql idminer [common params] [-difficulty number] [-loop [true]]",
+	UsageLine: "cql idminer [common params] [-difficulty number] [-loop [true]] [-resume] [-checkpoint-interval duration] [-show-best]",
 	Short:     "calculate nonce and node id for config.yaml file",
 	Long: `
 IDMiner calculates legal node id and it's nonce. Default parameters are difficulty of 24 and
@@ -51,6 +59,12 @@ e.g.
 
 If you want mining a good id, use:
     cql idminer -config ~/.cql/config.yaml -loop -difficulty 24
+
+"-loop" mining checkpoints each miner's best nonce to "<config-dir>/idminer-state/" every
+-checkpoint-interval (default 30s), and resumes every miner from its checkpoint on the next
+"-loop" invocation for the same public key, so a crash or reboot doesn't lose hours of work.
+Pass "-resume=false" to force a clean start, or "-show-best" to print the current best
+checkpoint without mining.
 `,
 	Flag:       flag.NewFlagSet("IDMiner params", flag.ExitOnError),
 	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
@@ -61,22 +75,176 @@ func init() {
 	CmdIDMiner.Run = runIDMiner
 
 	addCommonFlags(CmdIDMiner)
+	addOutputFlag(CmdIDMiner)
 	addConfigFlag(CmdIDMiner)
 	CmdIDMiner.Flag.IntVar(&difficulty, "difficulty", 24, "Difficulty for miner to mine nodes and generating nonce")
 	CmdIDMiner.Flag.BoolVar(&loop, "loop", false, "Keep mining until interrupted")
+	CmdIDMiner.Flag.BoolVar(&resumeLoop, "resume", true, "Resume -loop mining from the last checkpoint matching the current public key")
+	CmdIDMiner.Flag.BoolVar(&showBest, "show-best", false, "Print the current best checkpointed nonce without mining")
+	CmdIDMiner.Flag.DurationVar(&checkpointInterval, "checkpoint-interval", 30*time.Second, "How often each -loop miner checkpoints its best nonce to disk")
+}
+
+// idMinerResult is the JSON document printed for -output=json on both
+// "cql idminer" and "cql idminer -loop".
+type idMinerResult struct {
+	Nonce      mine.Uint256 `json:"nonce"`
+	Difficulty int          `json:"difficulty"`
+	NodeID     string       `json:"node_id"`
+	PublicKey  string       `json:"public_key"`
+	ElapsedMs  int64        `json:"elapsed_ms"`
+	Verified   bool         `json:"verified"`
+}
+
+// progressEvent is a single newline-delimited JSON progress line emitted
+// in place of the `\r`-overwritten human-readable progress line.
+type progressEvent struct {
+	Event      string `json:"event"`
+	Difficulty int    `json:"difficulty"`
+	Hashes     int    `json:"hashes"`
+	ElapsedMs  int64  `json:"elapsed_ms"`
+}
+
+// minerCheckpoint is the on-disk record of a single -loop miner's
+// progress, written atomically every -checkpoint-interval so mining can
+// resume after a crash or reboot instead of starting from scratch.
+type minerCheckpoint struct {
+	PublicKeyFingerprint string       `json:"public_key_fingerprint"`
+	Nonce                mine.Uint256 `json:"nonce"`
+	Difficulty           int          `json:"difficulty"`
+	Hash                 string       `json:"hash"`
+	Cursor               mine.Uint256 `json:"cursor"`
 }
 
 func runIDMiner(cmd *Command, args []string) {
 	publicKey := getPublicFromConfig()
 
+	if showBest {
+		printBestCheckpoint(publicKey)
+		return
+	}
+
 	if loop {
+		if checkpointInterval <= 0 {
+			err := fmt.Errorf("idminer command needs a positive -checkpoint-interval")
+			if jsonOutput() {
+				printResultError(err)
+			} else {
+				ConsoleLog.Error(err.Error())
+			}
+			SetExitStatus(1)
+			return
+		}
 		nonceLoop(publicKey)
 	} else {
 		_ = nonceGen(publicKey)
 	}
 }
 
+func publicKeyFingerprint(publicKey *asymmetric.PublicKey) string {
+	return fmt.Sprintf("%x", publicKey.Serialize())
+}
+
+func idMinerStateDir() string {
+	dir := filepath.Dir(configFile)
+	if dir == "" {
+		dir = "."
+	}
+	return filepath.Join(dir, "idminer-state")
+}
+
+func checkpointPath(worker int) string {
+	return filepath.Join(idMinerStateDir(), fmt.Sprintf("miner-%d.json", worker))
+}
+
+// loadCheckpoint reads worker's checkpoint, returning false if none
+// exists or it was written for a different public key.
+func loadCheckpoint(worker int, fingerprint string) (minerCheckpoint, bool) {
+	data, err := ioutil.ReadFile(checkpointPath(worker))
+	if err != nil {
+		return minerCheckpoint{}, false
+	}
+	var cp minerCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return minerCheckpoint{}, false
+	}
+	if cp.PublicKeyFingerprint != fingerprint {
+		return minerCheckpoint{}, false
+	}
+	return cp, true
+}
+
+// saveCheckpoint atomically writes worker's checkpoint via a temp file
+// and rename, so a crash mid-write can never leave a corrupt checkpoint.
+func saveCheckpoint(worker int, cp minerCheckpoint) error {
+	if err := os.MkdirAll(idMinerStateDir(), 0750); err != nil {
+		return err
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	path := checkpointPath(worker)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// printBestCheckpoint prints the best nonce checkpointed across all
+// workers for publicKey, without mining.
+func printBestCheckpoint(publicKey *asymmetric.PublicKey) {
+	fingerprint := publicKeyFingerprint(publicKey)
+
+	paths, _ := filepath.Glob(filepath.Join(idMinerStateDir(), "miner-*.json"))
+
+	var best minerCheckpoint
+	found := false
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var cp minerCheckpoint
+		if err := json.Unmarshal(data, &cp); err != nil || cp.PublicKeyFingerprint != fingerprint {
+			continue
+		}
+		if !found || cp.Difficulty > best.Difficulty {
+			best = cp
+			found = true
+		}
+	}
+
+	if !found {
+		err := fmt.Errorf("no checkpoint found for this public key in %s", idMinerStateDir())
+		if jsonOutput() {
+			printResultError(err)
+		} else {
+			ConsoleLog.Error(err.Error())
+		}
+		SetExitStatus(1)
+		return
+	}
+
+	if jsonOutput() {
+		printResult(idMinerResult{
+			Nonce:      best.Nonce,
+			Difficulty: best.Difficulty,
+			NodeID:     best.Hash,
+			PublicKey:  fingerprint,
+		})
+		return
+	}
+	fmt.Printf("nonce: %v\n", best.Nonce)
+	fmt.Printf("difficulty: %v\n", best.Difficulty)
+	fmt.Printf("node id: %v\n", best.Hash)
+}
+
 func nonceLoop(publicKey *asymmetric.PublicKey) {
+	start := monotime.Now()
+	fingerprint := publicKeyFingerprint(publicKey)
+	publicKeyBytes := publicKey.Serialize()
+
 	cpuCount := runtime.NumCPU()
 	ConsoleLog.Infof("cpu: %#v\n", cpuCount)
 	nonceChs := make([]chan mine.NonceInfo, cpuCount)
@@ -86,21 +254,62 @@ func nonceLoop(publicKey *asymmetric.PublicKey) {
 	step := math.MaxUint64 / uint64(cpuCount)
 
 	for i := 0; i < cpuCount; i++ {
-		nonceChs[i] = make(chan mine.NonceInfo)
+		nonceChs[i] = make(chan mine.NonceInfo, 1)
 		stopChs[i] = make(chan struct{})
-		go func(i int) {
-			miner := mine.NewCPUMiner(stopChs[i])
+
+		workerStart := mine.Uint256{D: step*uint64(i) + uint64(rand.Uint32())}
+		var best mine.NonceInfo
+		if resumeLoop {
+			if cp, ok := loadCheckpoint(i, fingerprint); ok {
+				workerStart = cp.Cursor
+				best = mine.NonceInfo{
+					Nonce:      cp.Nonce,
+					Difficulty: cp.Difficulty,
+					Hash:       mine.HashBlock(publicKeyBytes, cp.Nonce),
+				}
+				ConsoleLog.Infof("miner #%v resuming from checkpoint, difficulty so far: %v\n", i, cp.Difficulty)
+			}
+		}
+		ConsoleLog.Infof("miner #%#v start: %#v\n", i, workerStart)
+
+		go func(i int, cursor mine.Uint256, best mine.NonceInfo) {
 			nonceCh := nonceChs[i]
-			block := mine.MiningBlock{
-				Data:      publicKey.Serialize(),
-				NonceChan: nonceCh,
-				Stop:      nil,
+			if best.Difficulty >= difficulty {
+				nonceCh <- best
+				return
 			}
-			start := mine.Uint256{D: step*uint64(i) + uint64(rand.Uint32())}
-			ConsoleLog.Infof("miner #%#v start: %#v\n", i, start)
-			miner.ComputeBlockNonce(block, start, difficulty)
-			//TODO(laodouya) add wait group
-		}(i)
+
+			ticker := time.NewTicker(checkpointInterval)
+			defer ticker.Stop()
+
+			for j := cursor; ; j.Inc() {
+				select {
+				case <-stopChs[i]:
+					nonceCh <- best
+					return
+				case <-ticker.C:
+					if err := saveCheckpoint(i, minerCheckpoint{
+						PublicKeyFingerprint: fingerprint,
+						Nonce:                best.Nonce,
+						Difficulty:           best.Difficulty,
+						Hash:                 best.Hash.String(),
+						Cursor:               j,
+					}); err != nil {
+						ConsoleLog.WithError(err).Warnf("miner #%v checkpoint failed\n", i)
+					}
+				default:
+					currentHash := mine.HashBlock(publicKeyBytes, j)
+					currentDifficulty := currentHash.Difficulty()
+					if currentDifficulty > best.Difficulty {
+						best = mine.NonceInfo{Nonce: j, Difficulty: currentDifficulty, Hash: currentHash}
+					}
+					if currentDifficulty >= difficulty {
+						nonceCh <- best
+						return
+					}
+				}
+			}
+		}(i, workerStart, best)
 	}
 
 	sig := <-utils.WaitForExit()
@@ -118,14 +327,27 @@ func nonceLoop(publicKey *asymmetric.PublicKey) {
 	}
 
 	// verify result
-	ConsoleLog.Infof("verify result: %#v\n", kms.IsIDPubNonceValid(&proto.RawNodeID{Hash: max.Hash}, &max.Nonce, publicKey))
+	verified := kms.IsIDPubNonceValid(&proto.RawNodeID{Hash: max.Hash}, &max.Nonce, publicKey)
+	ConsoleLog.Infof("verify result: %#v\n", verified)
 
 	// print result
+	if jsonOutput() {
+		printResult(idMinerResult{
+			Nonce:      max.Nonce,
+			Difficulty: max.Difficulty,
+			NodeID:     max.Hash.String(),
+			PublicKey:  fingerprint,
+			ElapsedMs:  monotime.Since(start).Milliseconds(),
+			Verified:   verified,
+		})
+		return
+	}
 	fmt.Printf("nonce: %v\n", max)
 	fmt.Printf("node id: %v\n", max.Hash.String())
 }
 
 func nonceGen(publicKey *asymmetric.PublicKey) *mine.NonceInfo {
+	start := monotime.Now()
 	publicKeyBytes := publicKey.Serialize()
 
 	cpuCount := runtime.NumCPU()
@@ -181,7 +403,7 @@ func nonceGen(publicKey *asymmetric.PublicKey) *mine.NonceInfo {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		var count, current int
+		var current, hashes int
 
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
@@ -191,13 +413,21 @@ func nonceGen(publicKey *asymmetric.PublicKey) *mine.NonceInfo {
 			case <-stopCh:
 				return
 			case mined := <-progressCh:
+				hashes++
 				if mined > current {
 					current = mined
-					fmt.Printf("\rnonce mining %v seconds, current difficulty: %v, target difficulty: %v", count, current, difficulty)
+					if jsonOutput() {
+						printEvent(progressEvent{Event: "progress", Difficulty: current, Hashes: hashes, ElapsedMs: monotime.Since(start).Milliseconds()})
+					} else {
+						fmt.Printf("\rnonce mining %v seconds, current difficulty: %v, target difficulty: %v", int(monotime.Since(start).Seconds()), current, difficulty)
+					}
 				}
 			case <-ticker.C:
-				count++
-				fmt.Printf("\rnonce mining %v seconds, current difficulty: %v, target difficulty: %v", count, current, difficulty)
+				if jsonOutput() {
+					printEvent(progressEvent{Event: "progress", Difficulty: current, Hashes: hashes, ElapsedMs: monotime.Since(start).Milliseconds()})
+				} else {
+					fmt.Printf("\rnonce mining %v seconds, current difficulty: %v, target difficulty: %v", int(monotime.Since(start).Seconds()), current, difficulty)
+				}
 			}
 		}
 	}()
@@ -205,10 +435,10 @@ func nonceGen(publicKey *asymmetric.PublicKey) *mine.NonceInfo {
 	nonce := <-nonceCh
 	close(stopCh)
 	wg.Wait()
-	fmt.Printf("\n")
 
 	// verify result
-	if !kms.IsIDPubNonceValid(&proto.RawNodeID{Hash: nonce.Hash}, &nonce.Nonce, publicKey) {
+	verified := kms.IsIDPubNonceValid(&proto.RawNodeID{Hash: nonce.Hash}, &nonce.Nonce, publicKey)
+	if !verified {
 		ConsoleLog.WithFields(logrus.Fields{
 			"nonce": nonce,
 			"id":    nonce.Hash.String(),
@@ -216,6 +446,18 @@ func nonceGen(publicKey *asymmetric.PublicKey) *mine.NonceInfo {
 	}
 
 	// print result
+	if jsonOutput() {
+		printResult(idMinerResult{
+			Nonce:      nonce.Nonce,
+			Difficulty: nonce.Difficulty,
+			NodeID:     nonce.Hash.String(),
+			PublicKey:  fmt.Sprintf("%x", publicKeyBytes),
+			ElapsedMs:  monotime.Since(start).Milliseconds(),
+			Verified:   verified,
+		})
+		return &nonce
+	}
+	fmt.Printf("\n")
 	fmt.Printf("nonce: %v\n", nonce)
 	fmt.Printf("node id: %v\n", nonce.Hash.String())
 
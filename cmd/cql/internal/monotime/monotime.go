@@ -0,0 +1,35 @@
+/*
+ * Copyright 2018-2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package monotime measures elapsed durations off the monotonic clock,
+// so a long-running process (e.g. "cql idminer -loop") reports progress
+// that can't jump backwards or stall because of an NTP correction or a
+// leap second adjusting the wall clock underneath it.
+package monotime
+
+import "time"
+
+// Now returns the current instant, carrying a monotonic reading. Only
+// Since (or Sub against another monotime.Now value) is safe to use on
+// it; its wall-clock component should not be formatted or persisted.
+func Now() time.Time {
+	return time.Now()
+}
+
+// Since returns the monotonic duration elapsed since start.
+func Since(start time.Time) time.Duration {
+	return time.Now().Sub(start)
+}
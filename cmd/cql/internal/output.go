@@ -0,0 +1,63 @@
+/*
+ * Copyright 2018-2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// outputFormatJSON is the value of -output that switches a command's
+// terminal writes from human-readable lines to a single JSON document
+// (plus newline-delimited JSON progress events where applicable).
+const outputFormatJSON = "json"
+
+// outputFormat holds the value of the shared -output flag.
+var outputFormat string
+
+func addOutputFlag(cmd *Command) {
+	cmd.CommonFlag.StringVar(&outputFormat, "output", "", `Output format, set to "json" for structured output`)
+}
+
+// jsonOutput reports whether the command was invoked with -output=json.
+func jsonOutput() bool {
+	return outputFormat == outputFormatJSON
+}
+
+// printResult prints v as the command's final JSON document on stdout.
+// It is the JSON counterpart of the human-readable printing paths and must
+// only be called when jsonOutput() is true.
+func printResult(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(os.Stdout, "{\"error\": %q}\n", err.Error())
+	}
+}
+
+// printEvent prints v as a newline-delimited JSON progress event on stdout.
+func printEvent(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	_ = enc.Encode(v)
+}
+
+// printResultError prints err as the single JSON error document a
+// -output=json caller expects, so scripts never see a mixture of log
+// lines and JSON on stdout.
+func printResultError(err error) {
+	printResult(map[string]string{"error": err.Error()})
+}
@@ -18,24 +18,31 @@ package internal
 
 import (
 	"flag"
+	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/SQLess/SQLess/client"
+	"github.com/SQLess/SQLess/cmd/cql/internal/feeoracle"
+	"github.com/SQLess/SQLess/conf"
 	"github.com/SQLess/SQLess/crypto/hash"
 	"github.com/SQLess/SQLess/proto"
 	"github.com/SQLess/SQLess/types"
 )
 
 var (
-	toUser    string
-	toDSN     string
-	amount    uint64
-	tokenType string
+	toUser        string
+	toDSN         string
+	amount        uint64
+	tokenType     string
+	chainIDFlag   uint
+	forceTransfer bool
+	feeFlag       uint64
 )
 
 // CmdTransfer is cql transfer command entity.
 var CmdTransfer = &Command{
-	UsageLine: "cql transfer [common params] [-wait-tx-confirm] [-to-user wallet | -to-dsn dsn] [-amount count] [-token token_type]",
+	UsageLine: "cql transfer [common params] [-wait-tx-confirm] [-to-user wallet | -to-dsn dsn] [-amount count] [-token token_type] [-chain-id id] [-force] [-fee count]",
 	Short:     "transfer token to target account",
 	Long: `
 Transfer transfers your token to the target account or database.
@@ -47,54 +54,118 @@ Since CovenantSQL is built on top of the blockchain, you need to wait for the tr
 confirmation before the transfer takes effect.
 e.g.
     cql transfer -wait-tx-confirm -to-dsn="cqlprotocol://xxxx" -amount=100 -token=Particle
+
+Every transfer is signed for the network's chain id to prevent a transfer captured on one
+chain (e.g. testnet) from being replayed on another. Use -chain-id to target a network other
+than the one in config.yaml, and -force to override a chain id mismatch against config.yaml
+or an embedded dsn chain id.
+
+When -fee is omitted, the fee oracle is consulted for a suggested fee; run
+"cql fee-oracle -token <token_type>" to see the recommendation without sending a transfer.
 `,
 	Flag:       flag.NewFlagSet("Transfer params", flag.ExitOnError),
 	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
 	DebugFlag:  flag.NewFlagSet("Debug params", flag.ExitOnError),
 }
 
+// transferResult is the JSON document printed for -output=json.
+type transferResult struct {
+	TxHash    string `json:"tx_hash"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Amount    uint64 `json:"amount"`
+	Token     string `json:"token"`
+	Confirmed bool   `json:"confirmed"`
+}
+
 func init() {
 	CmdTransfer.Run = runTransfer
 
 	addCommonFlags(CmdTransfer)
+	addOutputFlag(CmdTransfer)
 	addConfigFlag(CmdTransfer)
 	addWaitFlag(CmdTransfer)
 	CmdTransfer.Flag.StringVar(&toUser, "to-user", "", "Target address of an user account to transfer token")
 	CmdTransfer.Flag.StringVar(&toDSN, "to-dsn", "", "Target database dsn to transfer token")
 	CmdTransfer.Flag.Uint64Var(&amount, "amount", 0, "Token account to transfer")
 	CmdTransfer.Flag.StringVar(&tokenType, "token", "", "Token type to transfer, e.g. Particle, Wave")
+	CmdTransfer.Flag.UintVar(&chainIDFlag, "chain-id", 0, "Chain id to sign the transfer for, defaults to the configured network's chain id")
+	CmdTransfer.Flag.BoolVar(&forceTransfer, "force", false, "Proceed even if -chain-id or the dsn's chain id does not match the configured network")
+	CmdTransfer.Flag.Uint64Var(&feeFlag, "fee", 0, "Fee to offer for the transfer; if omitted, a fee is suggested by the fee oracle")
+}
+
+// dsnChainID extracts the chain_id query parameter embedded in a
+// cqlprotocol DSN, e.g. "cqlprotocol://addr?chain_id=1", if any is present.
+// The match is anchored on a preceding '?' or '&' so a lookalike key such
+// as "blockchain_id=" is not mistaken for "chain_id=".
+func dsnChainID(dsn string) (id uint32, ok bool, err error) {
+	const key = "chain_id="
+
+	query := dsn
+	if q := strings.IndexByte(dsn, '?'); q >= 0 {
+		query = dsn[q+1:]
+	} else {
+		return 0, false, nil
+	}
+
+	for _, param := range strings.Split(query, "&") {
+		if !strings.HasPrefix(param, key) {
+			continue
+		}
+		parsed, err := strconv.ParseUint(param[len(key):], 10, 32)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid chain_id in dsn: %w", err)
+		}
+		return uint32(parsed), true, nil
+	}
+	return 0, false, nil
+}
+
+// failTransfer reports a transfer failure either as a log line or, under
+// -output=json, as the single JSON error document scripts expect.
+func failTransfer(err error, msg string) {
+	if jsonOutput() {
+		printResultError(fmt.Errorf("%s: %w", msg, err))
+	} else {
+		ConsoleLog.WithError(err).Error(msg)
+	}
+	SetExitStatus(1)
 }
 
 func runTransfer(cmd *Command, args []string) {
 	commonFlagsInit(cmd)
 
 	if len(args) > 0 || (toUser == "" && toDSN == "") || tokenType == "" {
-		ConsoleLog.Error("transfer command need to-user(or to-dsn) address and token type as param")
-		SetExitStatus(1)
-		printCommandHelp(cmd)
+		failTransfer(fmt.Errorf("need to-user(or to-dsn) address and token type as param"), "transfer token failed")
+		if !jsonOutput() {
+			printCommandHelp(cmd)
+		}
 		Exit()
 	}
 	if toUser != "" && toDSN != "" {
-		ConsoleLog.Error("transfer command accepts either to-user or to-dsn as param")
-		SetExitStatus(1)
-		printCommandHelp(cmd)
+		failTransfer(fmt.Errorf("accepts either to-user or to-dsn as param"), "transfer token failed")
+		if !jsonOutput() {
+			printCommandHelp(cmd)
+		}
 		Exit()
 	}
 
 	unit := types.FromString(tokenType)
 	if !unit.Listed() {
-		ConsoleLog.Error("transfer token failed: invalid token type")
-		SetExitStatus(1)
+		failTransfer(fmt.Errorf("invalid token type"), "transfer token failed")
 		return
 	}
 
 	var addr string
+	rawDSN := toDSN
+	if q := strings.IndexByte(toDSN, '?'); q >= 0 {
+		toDSN = toDSN[:q]
+	}
 	if toUser != "" {
 		addr = toUser
 	} else {
 		if !strings.HasPrefix(toDSN, client.DBScheme) && !strings.HasPrefix(toDSN, client.DBSchemeAlias) {
-			ConsoleLog.Error("transfer token failed: invalid dsn provided, use address start with 'cqlprotocol://'")
-			SetExitStatus(1)
+			failTransfer(fmt.Errorf("invalid dsn provided, use address start with 'cqlprotocol://'"), "transfer token failed")
 			return
 		}
 		toDSN = strings.TrimLeft(toDSN, client.DBScheme+"://")
@@ -103,28 +174,66 @@ func runTransfer(cmd *Command, args []string) {
 
 	targetAccountHash, err := hash.NewHashFromStr(addr)
 	if err != nil {
-		ConsoleLog.WithError(err).Error("target account address is not valid")
-		SetExitStatus(1)
+		failTransfer(err, "target account address is not valid")
 		return
 	}
 	targetAccount := proto.AccountAddress(*targetAccountHash)
 
 	configInit()
 
-	txHash, err := client.TransferToken(targetAccount, amount, unit)
+	chainID := conf.GConf.ChainID
+	if chainIDFlag != 0 && uint32(chainIDFlag) != chainID && !forceTransfer {
+		failTransfer(fmt.Errorf("requested chain id %d does not match configured network %d, use -force to override", chainIDFlag, chainID), "transfer token failed")
+		return
+	}
+	if chainIDFlag != 0 {
+		chainID = uint32(chainIDFlag)
+	}
+	if dsnID, ok, err := dsnChainID(rawDSN); err != nil {
+		failTransfer(err, "transfer token failed")
+		return
+	} else if ok && dsnID != chainID && !forceTransfer {
+		failTransfer(fmt.Errorf("dsn chain id %d does not match configured network %d, use -force to override", dsnID, chainID), "transfer token failed")
+		return
+	}
+
+	fee := feeFlag
+	if fee == 0 {
+		suggestion, err := feeoracle.Suggest(unit, feeoracle.DefaultConfig)
+		if err != nil {
+			failTransfer(err, "fee oracle failed")
+			return
+		}
+		fee = suggestion.Fee
+		ConsoleLog.Infof("fee oracle suggests fee %v for %v (sampled %v blocks at %vth percentile)",
+			fee, tokenType, suggestion.Blocks, suggestion.Percentile)
+	}
+	txHash, err := client.TransferTokenOnChain(targetAccount, amount, unit, chainID, fee)
 	if err != nil {
-		ConsoleLog.WithError(err).Error("transfer token failed")
-		SetExitStatus(1)
+		failTransfer(err, "transfer token failed")
 		return
 	}
 
+	confirmed := false
 	if waitTxConfirmation {
 		err = wait(txHash)
 		if err != nil {
-			ConsoleLog.WithError(err).Error("transfer token failed")
-			SetExitStatus(1)
+			failTransfer(err, "transfer token failed")
 			return
 		}
+		confirmed = true
+	}
+
+	if jsonOutput() {
+		printResult(transferResult{
+			TxHash:    txHash.String(),
+			From:      fmt.Sprintf("%x", getPublicFromConfig().Serialize()),
+			To:        addr,
+			Amount:    amount,
+			Token:     tokenType,
+			Confirmed: confirmed,
+		})
+		return
 	}
 
 	ConsoleLog.Info("succeed in sending transaction to CQL")
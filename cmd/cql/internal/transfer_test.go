@@ -0,0 +1,52 @@
+/*
+ * Copyright 2018-2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import "testing"
+
+func TestDsnChainID(t *testing.T) {
+	testCases := []struct {
+		name    string
+		dsn     string
+		wantID  uint32
+		wantOK  bool
+		wantErr bool
+	}{
+		{"no query", "cqlprotocol://abc", 0, false, false},
+		{"chain_id present", "cqlprotocol://abc?chain_id=1", 1, true, false},
+		{"chain_id not first param", "cqlprotocol://abc?foo=bar&chain_id=42", 42, true, false},
+		{"chain_id followed by other params", "cqlprotocol://abc?chain_id=7&foo=bar", 7, true, false},
+		{"lookalike key is not matched", "cqlprotocol://abc?blockchain_id=99", 0, false, false},
+		{"lookalike key alongside real key", "cqlprotocol://abc?blockchain_id=99&chain_id=3", 3, true, false},
+		{"invalid value", "cqlprotocol://abc?chain_id=notanumber", 0, false, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, ok, err := dsnChainID(tc.dsn)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("dsnChainID(%q) error = %v, wantErr %v", tc.dsn, err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if ok != tc.wantOK || id != tc.wantID {
+				t.Fatalf("dsnChainID(%q) = (%v, %v), want (%v, %v)", tc.dsn, id, ok, tc.wantID, tc.wantOK)
+			}
+		})
+	}
+}